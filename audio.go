@@ -8,7 +8,7 @@ import (
 )
 
 /*
-#cgo pkg-config: libavformat libavcodec libavutil libswresample
+#cgo pkg-config: libavformat libavcodec libavutil libswresample libavfilter
 #include <libavutil/samplefmt.h>
 #include <libavformat/avformat.h>
 */
@@ -20,7 +20,8 @@ func init() {
 
 /* FormatContext represents a decoding context of eg. an open file. */
 type FormatContext struct {
-	ctx *C.AVFormatContext
+	ctx      *C.AVFormatContext
+	customIO unsafe.Pointer // opaque handle for an OpenReader-backed AVIOContext, if any
 }
 
 type SampleStream interface {
@@ -30,8 +31,12 @@ type SampleStream interface {
 	/* Releases any resources associated with the stream. */
 	Close()
 
-	/* returns raw audio data (1 pointer per plane) and number of samples (per plane), or an error */
-	read_raw() (**C.uint8_t, C.int, error)
+	/* returns raw audio data (1 pointer per plane), number of samples (per plane), and the
+	AudioFormat the data is actually stored in, or an error. The format is returned
+	alongside the data (rather than assumed to be Format()'s return value) because some
+	streams - notably AudioStream, when the underlying decoder hits a format-change event -
+	can start yielding frames in a different format mid-stream. */
+	read_raw() (**C.uint8_t, C.int, AudioFormat, error)
 }
 
 type AudioStream struct {
@@ -54,6 +59,8 @@ func avError(errnum C.int) error {
 	switch errnum {
 	case C.AVERROR_EOF:
 		return io.EOF
+	case eagainErrno:
+		return ErrAgain
 	}
 	var buf [256]C.char
 	cp := (*C.char)(unsafe.Pointer(&buf[0]))
@@ -76,7 +83,13 @@ func OpenFile(filename string) (*FormatContext, error) {
 
 /* Closes a FormatContext, releasing associated resources. */
 func (format *FormatContext) Close() {
+	pb := format.ctx.pb
 	C.avformat_close_input(&format.ctx)
+	if format.customIO != nil {
+		C.av_free(unsafe.Pointer(pb.buffer))
+		C.avio_context_free(&pb)
+		releaseHandle(format.customIO)
+	}
 }
 
 func (format *FormatContext) stream(index int) *C.AVStream {
@@ -97,6 +110,15 @@ func (format *FormatContext) findStreamInfo() error {
 
 /* Returns the "best" AudioStream found in the file. */
 func (format *FormatContext) OpenAudioStream() (*AudioStream, error) {
+	return format.openAudioStream(0, NoSamples)
+}
+
+/* Like OpenAudioStream, but hints the decoder towards reqLayout/reqFmt (via
+AVCodecContext.request_channel_layout/request_sample_fmt) before opening it,
+so callers that need a specific format can skip a Resampler entirely when
+the decoder is able to honour the request directly. A zero reqLayout or
+reqFmt of NoSamples means "no preference". */
+func (format *FormatContext) openAudioStream(reqLayout ChannelLayout, reqFmt SampleFmt) (*AudioStream, error) {
 	err := format.findStreamInfo()
 	if err != nil {
 		return nil, err
@@ -111,6 +133,12 @@ func (format *FormatContext) OpenAudioStream() (*AudioStream, error) {
 	if decoder == nil {
 		return nil, errors.New("No decoder available")
 	}
+	if reqLayout != 0 {
+		dec_ctx.request_channel_layout = C.uint64_t(reqLayout)
+	}
+	if reqFmt != NoSamples {
+		dec_ctx.request_sample_fmt = int32(reqFmt)
+	}
 	dict := (*C.AVDictionary)(nil)
 	r := C.avcodec_open2(dec_ctx, decoder, &dict)
 	if r < 0 {
@@ -167,24 +195,25 @@ func (audio *AudioStream) decode() (bool, error) {
 }
 
 /* note: can return data chunks of length zero. error will be io.EOF at end of stream */
-func (audio *AudioStream) read_raw() (**C.uint8_t, C.int, error) {
+func (audio *AudioStream) read_raw() (**C.uint8_t, C.int, AudioFormat, error) {
 	if audio.pkt.size == 0 && !audio.framesEOF {
 		err := audio.read_frame()
 		if err == io.EOF {
 			audio.framesEOF = true
 		} else if err != nil {
-			return nil, 0, err
+			return nil, 0, audio.fmt, err
 		}
 	}
 	gotFrame, err := audio.decode()
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, audio.fmt, err
 	}
 	if !gotFrame {
 		if audio.framesEOF {
-			return nil, 0, io.EOF
+			return nil, 0, audio.fmt, io.EOF
 		}
-		return nil, 0, nil
+		return nil, 0, audio.fmt, nil
 	}
-	return audio.frame.extended_data, audio.frame.nb_samples, nil
+	frameFmt := AudioFormat{int(audio.frame.sample_rate), SampleFmt(audio.frame.format), ChannelLayout(audio.frame.channel_layout)}
+	return audio.frame.extended_data, audio.frame.nb_samples, frameFmt, nil
 }
@@ -1,6 +1,7 @@
 package ffau
 
 // #include <libavutil/samplefmt.h>
+// #include <libavcodec/avcodec.h>
 import "C"
 
 type SampleFmt int8
@@ -19,3 +20,15 @@ const (
 	PlanarFloats  SampleFmt = C.AV_SAMPLE_FMT_FLTP ///< float, planar
 	PlanarDoubles SampleFmt = C.AV_SAMPLE_FMT_DBLP ///< double, planar
 )
+
+/* CodecID identifies an encoder/decoder implementation, eg. for use with CreateFile. */
+type CodecID int32
+
+const (
+	NoCodec   CodecID = C.AV_CODEC_ID_NONE
+	PCM_S16LE CodecID = C.AV_CODEC_ID_PCM_S16LE
+	MP3       CodecID = C.AV_CODEC_ID_MP3
+	AAC       CodecID = C.AV_CODEC_ID_AAC
+	Vorbis    CodecID = C.AV_CODEC_ID_VORBIS
+	FLAC      CodecID = C.AV_CODEC_ID_FLAC
+)
@@ -0,0 +1,55 @@
+package ffau
+
+import (
+	"errors"
+	"unsafe"
+)
+
+/*
+#cgo pkg-config: libavdevice
+#include <errno.h>
+#include <libavdevice/avdevice.h>
+#include <libavformat/avformat.h>
+
+static int ffau_averror_eagain(void) {
+	return AVERROR(EAGAIN);
+}
+*/
+import "C"
+
+/* ErrAgain is returned (wrapped nowhere further, compare with ==) in place of
+an opaque error when a non-blocking source - typically a device opened with
+OpenDevice - has no data available yet, so callers can fold it into Go's
+select/timeout patterns instead of treating it as a hard failure. */
+var ErrAgain = errors.New("resource temporarily unavailable")
+
+var eagainErrno C.int
+
+func init() {
+	C.avdevice_register_all()
+	eagainErrno = C.ffau_averror_eagain()
+}
+
+/* Opens a capture device (eg. driver "alsa"/"pulse"/"avfoundation"/"dshow", device
+the driver-specific device name such as "default" or "hw:0") and returns a
+FormatContext which can be used to decode it like any other SampleStream source. */
+func OpenDevice(driver, device string) (*FormatContext, error) {
+	cdriver := C.CString(driver)
+	defer C.free(unsafe.Pointer(cdriver))
+	cdevice := C.CString(device)
+	defer C.free(unsafe.Pointer(cdevice))
+
+	inputFmt := C.av_find_input_format(cdriver)
+	if inputFmt == nil {
+		return nil, errors.New("unknown input driver " + driver)
+	}
+	var ctx FormatContext
+	r := C.avformat_open_input(&ctx.ctx, cdevice, inputFmt, nil)
+	if r < 0 {
+		return nil, avError(r)
+	}
+	/* without this, av_read_frame blocks waiting for data instead of ever
+	returning AVERROR(EAGAIN), making ErrAgain unreachable for devices. */
+	ctx.ctx.flags |= C.AVFMT_FLAG_NONBLOCK
+	return &ctx, nil
+}
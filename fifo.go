@@ -0,0 +1,133 @@
+package ffau
+
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// #include <libavutil/audio_fifo.h>
+import "C"
+
+/* Chunker rechunks a SampleStream into fixed-size frames. Decoder output frame
+sizes are codec-dependent (1152 for MP2, 1024 for AAC, variable for Opus), but
+encoders, network transports and FFT/visualization code usually want fixed,
+often power-of-two, chunks. Chunker itself implements SampleStream. */
+type Chunker struct {
+	source         SampleStream
+	fmt            AudioFormat
+	framesPerChunk C.int
+	fifo           *C.AVAudioFifo
+	nplanes        int
+	data           **C.uint8_t
+	nf             C.int // samples allocated (per plane) in data/buf
+	buf            *C.uint8_t
+	sourceEOF      bool
+}
+
+/* Wraps source so that read_raw always returns framesPerChunk samples at a
+time (except for a final short chunk at EOF), buffering through an internal
+AVAudioFifo. framesPerChunk <= 0 means "no fixed frame size required" (eg.
+frame_size is reported as 0 for PCM and other codecs with no fixed frame
+size) - source is returned unchanged in that case. */
+func NewChunker(source SampleStream, framesPerChunk int) (SampleStream, error) {
+	if framesPerChunk <= 0 {
+		return source, nil
+	}
+	fmt := source.Format()
+	chunker := &Chunker{source: source, fmt: fmt, framesPerChunk: C.int(framesPerChunk)}
+	chunker.nplanes = fmt.NumPlanes()
+	chunker.fifo = C.av_audio_fifo_alloc(int32(fmt.Storage), C.int(fmt.NumChannels()), C.int(framesPerChunk))
+	if chunker.fifo == nil {
+		return nil, errors.New("couldn't allocate chunker fifo")
+	}
+	chunker.data = (**C.uint8_t)(C.malloc(C.size_t(uintptr(chunker.nplanes * sizeOfPtr))))
+	if chunker.data == nil {
+		C.av_audio_fifo_free(chunker.fifo)
+		return nil, errors.New("couldn't allocate chunker channel pointers")
+	}
+	return chunker, nil
+}
+
+func (chunker *Chunker) Format() AudioFormat {
+	return chunker.fmt
+}
+
+/* Releases memory associated with the Chunker, and closes the source stream. */
+func (chunker *Chunker) Close() {
+	chunker.freeBuffers()
+	chunker.source.Close()
+}
+
+/* Frees the Chunker's own native memory without touching source, for callers
+(eg. Muxer.Write) that construct a Chunker around a stream they don't own. */
+func (chunker *Chunker) freeBuffers() {
+	C.av_audio_fifo_free(chunker.fifo)
+	C.free(unsafe.Pointer(chunker.data))
+	if chunker.buf != nil {
+		C.free(unsafe.Pointer(chunker.buf))
+	}
+}
+
+/* Identical in spirit to Resampler.checkBuf: (re)allocates chunker.buf so
+that chunker.data has room for nf samples per plane, wiring up one pointer
+per plane into the (packed or planar) contiguous block. */
+func (chunker *Chunker) checkBuf(nf C.int) error {
+	if chunker.nf < nf {
+		bpc := int(nf * C.av_get_bytes_per_sample(int32(chunker.fmt.Storage)))
+		nbytes := bpc * chunker.fmt.NumChannels()
+		if chunker.buf != nil {
+			C.free(unsafe.Pointer(chunker.buf))
+			chunker.buf = nil
+		}
+		chunker.buf = (*C.uint8_t)(C.malloc(C.size_t(nbytes)))
+		if chunker.buf == nil {
+			return errors.New("couldn't allocate chunker data block")
+		}
+
+		data_0 := uintptr(unsafe.Pointer(chunker.data))
+		buf_0 := uintptr(unsafe.Pointer(chunker.buf))
+		for i := 0; i < chunker.nplanes; i++ {
+			data_i := (**C.uint8_t)(unsafe.Pointer(data_0 + uintptr(i*sizeOfPtr)))
+			*data_i = (*C.uint8_t)(unsafe.Pointer(buf_0 + uintptr(i*bpc)))
+		}
+		chunker.nf = nf
+	}
+	return nil
+}
+
+func (chunker *Chunker) read_raw() (**C.uint8_t, C.int, AudioFormat, error) {
+	for !chunker.sourceEOF && C.av_audio_fifo_size(chunker.fifo) < chunker.framesPerChunk {
+		data, nf, _, err := chunker.source.read_raw()
+		if err == io.EOF {
+			chunker.sourceEOF = true
+			break
+		} else if err != nil {
+			return nil, 0, chunker.fmt, err
+		}
+		if nf == 0 {
+			continue
+		}
+		r := C.av_audio_fifo_write(chunker.fifo, (*unsafe.Pointer)(unsafe.Pointer(data)), nf)
+		if r < nf {
+			return nil, 0, chunker.fmt, errors.New("short write to chunker fifo")
+		}
+	}
+
+	avail := C.av_audio_fifo_size(chunker.fifo)
+	if avail == 0 {
+		return nil, 0, chunker.fmt, io.EOF
+	}
+	want := chunker.framesPerChunk
+	if avail < want {
+		want = avail
+	}
+	if err := chunker.checkBuf(want); err != nil {
+		return nil, 0, chunker.fmt, err
+	}
+	n := C.av_audio_fifo_read(chunker.fifo, (*unsafe.Pointer)(unsafe.Pointer(chunker.data)), want)
+	if n < 0 {
+		return nil, 0, chunker.fmt, avError(n)
+	}
+	return chunker.data, n, chunker.fmt, nil
+}
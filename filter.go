@@ -0,0 +1,195 @@
+package ffau
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+/*
+#include <errno.h>
+#include <libavcodec/avcodec.h>
+#include <libavfilter/avfilter.h>
+#include <libavfilter/buffersrc.h>
+#include <libavfilter/buffersink.h>
+#include <libavutil/opt.h>
+#include <libavutil/channel_layout.h>
+*/
+import "C"
+
+/* FilterGraph passes a SampleStream through an libavfilter graph described by
+an ffmpeg filter string (eg. "atempo=1.25,volume=0.5"), and itself implements
+SampleStream so it can be chained with Resample or a Muxer. */
+type FilterGraph struct {
+	source     SampleStream
+	fmt        AudioFormat
+	graph      *C.AVFilterGraph
+	buffersrc  *C.AVFilterContext
+	buffersink *C.AVFilterContext
+	frame      *C.AVFrame
+	sourceEOF  bool
+}
+
+/* Builds a filter graph that reads source through an abuffer, applies descr,
+and terminates at an abuffersink whose output format matches descr's last
+aformat (or source's format, if descr doesn't change it). */
+func NewFilterGraph(source SampleStream, descr string) (*FilterGraph, error) {
+	from := source.Format()
+	fg := &FilterGraph{source: source, fmt: from}
+
+	fg.graph = C.avfilter_graph_alloc()
+	if fg.graph == nil {
+		return nil, errors.New("couldn't allocate filter graph")
+	}
+
+	args := C.CString(fmt.Sprintf(
+		"time_base=1/%d:sample_rate=%d:sample_fmt=%s:channel_layout=0x%x",
+		from.Rate, from.Rate, sampleFmtName(from.Storage), uint64(from.Layout)))
+	defer C.free(unsafe.Pointer(args))
+
+	abufferName := C.CString("abuffer")
+	defer C.free(unsafe.Pointer(abufferName))
+	abuffer := C.avfilter_get_by_name(abufferName)
+	cname := C.CString("src")
+	defer C.free(unsafe.Pointer(cname))
+	r := C.avfilter_graph_create_filter(&fg.buffersrc, abuffer, cname, args, nil, fg.graph)
+	if r < 0 {
+		return nil, avError(r)
+	}
+
+	abuffersinkName := C.CString("abuffersink")
+	defer C.free(unsafe.Pointer(abuffersinkName))
+	abuffersink := C.avfilter_get_by_name(abuffersinkName)
+	cname2 := C.CString("sink")
+	defer C.free(unsafe.Pointer(cname2))
+	r = C.avfilter_graph_create_filter(&fg.buffersink, abuffersink, cname2, nil, nil, fg.graph)
+	if r < 0 {
+		return nil, avError(r)
+	}
+
+	outputs := C.avfilter_inout_alloc()
+	inputs := C.avfilter_inout_alloc()
+	if outputs == nil || inputs == nil {
+		return nil, errors.New("couldn't allocate filter graph endpoints")
+	}
+	outName := C.CString("in")
+	outputs.name = outName
+	outputs.filter_ctx = fg.buffersrc
+	outputs.pad_idx = 0
+	outputs.next = nil
+
+	inName := C.CString("out")
+	inputs.name = inName
+	inputs.filter_ctx = fg.buffersink
+	inputs.pad_idx = 0
+	inputs.next = nil
+
+	cdescr := C.CString(descr)
+	defer C.free(unsafe.Pointer(cdescr))
+	r = C.avfilter_graph_parse_ptr(fg.graph, cdescr, &inputs, &outputs, nil)
+	if r < 0 {
+		return nil, avError(r)
+	}
+	r = C.avfilter_graph_config(fg.graph, nil)
+	if r < 0 {
+		return nil, avError(r)
+	}
+
+	fg.frame = C.av_frame_alloc()
+	if fg.frame == nil {
+		return nil, errors.New("couldn't allocate frame")
+	}
+
+	fg.fmt = AudioFormat{
+		Rate:    int(C.av_buffersink_get_sample_rate(fg.buffersink)),
+		Storage: SampleFmt(C.av_buffersink_get_format(fg.buffersink)),
+		Layout:  ChannelLayout(C.av_buffersink_get_channel_layout(fg.buffersink)),
+	}
+	return fg, nil
+}
+
+func sampleFmtName(fmt SampleFmt) string {
+	return C.GoString(C.av_get_sample_fmt_name(int32(fmt)))
+}
+
+func (fg *FilterGraph) Format() AudioFormat {
+	return fg.fmt
+}
+
+func (fg *FilterGraph) Close() {
+	C.av_frame_free(&fg.frame)
+	C.avfilter_graph_free(&fg.graph)
+	fg.source.Close()
+}
+
+func (fg *FilterGraph) read_raw() (**C.uint8_t, C.int, AudioFormat, error) {
+	for {
+		r := C.av_buffersink_get_frame(fg.buffersink, fg.frame)
+		if r >= 0 {
+			return fg.frame.extended_data, fg.frame.nb_samples, fg.fmt, nil
+		}
+		if r != -C.EAGAIN && r != C.AVERROR_EOF {
+			return nil, 0, fg.fmt, avError(r)
+		}
+		if fg.sourceEOF {
+			return nil, 0, fg.fmt, io.EOF
+		}
+		if err := fg.pushSource(); err != nil {
+			return nil, 0, fg.fmt, err
+		}
+	}
+}
+
+func (fg *FilterGraph) pushSource() error {
+	data, nf, in, err := fg.source.read_raw()
+	if err == io.EOF {
+		fg.sourceEOF = true
+		r := C.av_buffersrc_add_frame(fg.buffersrc, nil)
+		if r < 0 {
+			return avError(r)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if nf == 0 {
+		return nil
+	}
+
+	frame := C.av_frame_alloc()
+	if frame == nil {
+		return errors.New("couldn't allocate frame")
+	}
+	defer C.av_frame_free(&frame)
+	frame.nb_samples = nf
+	frame.format = C.int(in.Storage)
+	frame.channel_layout = C.uint64_t(in.Layout)
+	frame.sample_rate = C.int(in.Rate)
+
+	/* data holds one pointer per plane (NumPlanes() of them); for planar audio
+	each plane may be a separate allocation, so - unlike packed audio - they can't be
+	derived from the first plane pointer alone. Point the frame straight at them
+	instead of going through avcodec_fill_audio_frame, which assumes a single
+	contiguous block. */
+	nplanes := in.NumPlanes()
+	bytesPerSample := int(C.av_get_bytes_per_sample(int32(in.Storage)))
+	planeSize := int(nf) * bytesPerSample
+	if nplanes == 1 {
+		planeSize *= in.NumChannels()
+	}
+	frame.linesize[0] = C.int(planeSize)
+	frame.extended_data = data
+	if nplanes <= 8 {
+		planes := (*[8]*C.uint8_t)(unsafe.Pointer(data))
+		for i := 0; i < nplanes; i++ {
+			frame.data[i] = planes[i]
+		}
+	}
+
+	r := C.av_buffersrc_add_frame(fg.buffersrc, frame)
+	if r < 0 {
+		return avError(r)
+	}
+	return nil
+}
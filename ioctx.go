@@ -0,0 +1,234 @@
+package ffau
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+/*
+#include <libavformat/avformat.h>
+#include "_cgo_export.h"
+
+static AVIOContext *ffau_alloc_reader(unsigned char *buf, int bufSize, void *opaque) {
+	return avio_alloc_context(buf, bufSize, 0, opaque, ffau_read_packet, NULL, ffau_seek);
+}
+
+static AVIOContext *ffau_alloc_writer(unsigned char *buf, int bufSize, void *opaque) {
+	return avio_alloc_context(buf, bufSize, 1, opaque, NULL, ffau_write_packet, ffau_seek);
+}
+*/
+import "C"
+
+const ioBufferSize = 4096
+
+var (
+	handleMu   sync.Mutex
+	handles    = map[unsafe.Pointer]interface{}{}
+	nextHandle uintptr
+)
+
+/* registerHandle stashes v behind an opaque token that survives the trip
+through a cgo callback (a real Go pointer cannot safely be passed as the
+AVIOContext opaque, since nothing in C keeps it reachable to the GC). */
+func registerHandle(v interface{}) unsafe.Pointer {
+	handleMu.Lock()
+	defer handleMu.Unlock()
+	nextHandle++
+	h := unsafe.Pointer(nextHandle)
+	handles[h] = v
+	return h
+}
+
+func lookupHandle(opaque unsafe.Pointer) interface{} {
+	handleMu.Lock()
+	defer handleMu.Unlock()
+	return handles[opaque]
+}
+
+func releaseHandle(opaque unsafe.Pointer) {
+	handleMu.Lock()
+	defer handleMu.Unlock()
+	delete(handles, opaque)
+}
+
+//export ffau_read_packet
+func ffau_read_packet(opaque unsafe.Pointer, buf *C.uint8_t, bufSize C.int) C.int {
+	r, _ := lookupHandle(opaque).(io.Reader)
+	if r == nil {
+		return C.AVERROR_EOF
+	}
+	dst := (*[1 << 30]byte)(unsafe.Pointer(buf))[:bufSize:bufSize]
+	n, err := r.Read(dst)
+	if n == 0 && err != nil {
+		return C.AVERROR_EOF
+	}
+	return C.int(n)
+}
+
+//export ffau_write_packet
+func ffau_write_packet(opaque unsafe.Pointer, buf *C.uint8_t, bufSize C.int) C.int {
+	w, _ := lookupHandle(opaque).(io.Writer)
+	if w == nil {
+		return C.AVERROR_EOF
+	}
+	src := (*[1 << 30]byte)(unsafe.Pointer(buf))[:bufSize:bufSize]
+	n, err := w.Write(src)
+	if err != nil {
+		return C.AVERROR_EOF
+	}
+	return C.int(n)
+}
+
+//export ffau_seek
+func ffau_seek(opaque unsafe.Pointer, offset C.int64_t, whence C.int) C.int64_t {
+	s, _ := lookupHandle(opaque).(io.Seeker)
+	if s == nil {
+		return -1
+	}
+	if whence == C.AVSEEK_SIZE {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		s.Seek(cur, io.SeekStart)
+		return C.int64_t(end)
+	}
+	pos, err := s.Seek(int64(offset), int(whence))
+	if err != nil {
+		return -1
+	}
+	return C.int64_t(pos)
+}
+
+/* Frees an AVIOContext allocated by ffau_alloc_reader/ffau_alloc_writer along
+with its buffer and registered handle, for error paths that need to unwind
+before a FormatContext/Muxer exists to own them via Close/abort. */
+func freeCustomIO(pb *C.AVIOContext, opaque unsafe.Pointer) {
+	C.av_free(unsafe.Pointer(pb.buffer))
+	C.avio_context_free(&pb)
+	releaseHandle(opaque)
+}
+
+/* Opens an audio stream backed by r instead of a filesystem path, so callers
+can decode from HTTP responses, archives, or in-memory buffers. */
+func OpenReader(r io.ReadSeeker) (*FormatContext, error) {
+	bufSize := C.int(ioBufferSize)
+	cbuf := C.av_malloc(C.size_t(bufSize) + C.AVPROBE_PADDING_SIZE)
+	if cbuf == nil {
+		return nil, errors.New("couldn't allocate avio buffer")
+	}
+	opaque := registerHandle(r)
+	pb := C.ffau_alloc_reader((*C.uchar)(cbuf), bufSize, opaque)
+	if pb == nil {
+		C.av_free(cbuf)
+		releaseHandle(opaque)
+		return nil, errors.New("couldn't allocate AVIOContext")
+	}
+
+	fmtCtx := C.avformat_alloc_context()
+	if fmtCtx == nil {
+		freeCustomIO(pb, opaque)
+		return nil, errors.New("couldn't allocate format context")
+	}
+	fmtCtx.pb = pb
+	fmtCtx.flags |= C.AVFMT_FLAG_CUSTOM_IO
+
+	cname := C.CString("")
+	defer C.free(unsafe.Pointer(cname))
+	var inputFmt *C.AVInputFormat
+	r2 := C.av_probe_input_buffer(pb, &inputFmt, cname, nil, 0, 0)
+	if r2 < 0 {
+		C.avformat_free_context(fmtCtx)
+		freeCustomIO(pb, opaque)
+		return nil, avError(r2)
+	}
+
+	r2 = C.avformat_open_input(&fmtCtx, nil, inputFmt, nil)
+	if r2 < 0 {
+		/* avformat_open_input frees fmtCtx itself on failure, but doesn't know
+		about the custom AVIOContext we attached to it first. */
+		freeCustomIO(pb, opaque)
+		return nil, avError(r2)
+	}
+	return &FormatContext{ctx: fmtCtx, customIO: opaque}, nil
+}
+
+/* The container format CreateWriter picks for a codec when there's no
+filename to guess one from. One muxer per codec is enough for the
+CodecIDs the package currently exposes. */
+func defaultContainer(codec CodecID) (string, error) {
+	switch codec {
+	case PCM_S16LE:
+		return "wav", nil
+	case MP3:
+		return "mp3", nil
+	case AAC:
+		return "adts", nil
+	case Vorbis:
+		return "ogg", nil
+	case FLAC:
+		return "flac", nil
+	}
+	return "", errors.New("no default container for this codec")
+}
+
+/* Creates a Muxer that writes encoded output to w instead of a filesystem
+path. This is the write-side counterpart to OpenReader. Since there's no
+filename for avformat_alloc_output_context2 to guess a container from, one
+is picked from codec via defaultContainer instead. */
+func CreateWriter(w io.Writer, codec CodecID, format AudioFormat) (*Muxer, error) {
+	shortName, err := defaultContainer(codec)
+	if err != nil {
+		return nil, err
+	}
+	cShortName := C.CString(shortName)
+	defer C.free(unsafe.Pointer(cShortName))
+	oformat := C.av_guess_format(cShortName, nil, nil)
+	if oformat == nil {
+		return nil, errors.New("couldn't find an output format for " + shortName)
+	}
+
+	bufSize := C.int(ioBufferSize)
+	cbuf := C.av_malloc(C.size_t(bufSize))
+	if cbuf == nil {
+		return nil, errors.New("couldn't allocate avio buffer")
+	}
+	opaque := registerHandle(w)
+	pb := C.ffau_alloc_writer((*C.uchar)(cbuf), bufSize, opaque)
+	if pb == nil {
+		C.av_free(cbuf)
+		releaseHandle(opaque)
+		return nil, errors.New("couldn't allocate AVIOContext")
+	}
+
+	avctx := C.avformat_alloc_context()
+	if avctx == nil {
+		freeCustomIO(pb, opaque)
+		return nil, errors.New("couldn't allocate format context")
+	}
+	avctx.oformat = oformat
+	avctx.pb = pb
+	avctx.flags |= C.AVFMT_FLAG_CUSTOM_IO
+
+	mux, err := newMuxer(avctx, codec, format)
+	if err != nil {
+		/* newMuxer's error paths already tore avctx/pb down via abort() -
+		mux.customIO isn't set until below, so abort() freed pb through the
+		AVFMT_FLAG_CUSTOM_IO branch rather than the customIO one. Just
+		release the handle, which abort() doesn't know about yet. */
+		releaseHandle(opaque)
+		return nil, err
+	}
+	mux.customIO = opaque
+	if err := mux.writeHeader(); err != nil {
+		mux.abort()
+		return nil, err
+	}
+	return mux, nil
+}
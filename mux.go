@@ -0,0 +1,225 @@
+package ffau
+
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+/*
+#include <libavformat/avformat.h>
+#include <libavcodec/avcodec.h>
+#include <libavutil/opt.h>
+*/
+import "C"
+
+/* Muxer encodes a SampleStream and writes it to an output file. It is the
+write-side counterpart to FormatContext/AudioStream. */
+type Muxer struct {
+	ctx      *C.AVFormatContext
+	stream   *C.AVStream
+	codec    *C.AVCodecContext
+	fmt      AudioFormat
+	frame    *C.AVFrame
+	pts      C.int64_t
+	customIO unsafe.Pointer // opaque handle for a CreateWriter-backed AVIOContext, if any
+}
+
+/* Creates filename, opens an encoder for codec and prepares a Muxer that
+accepts samples in the given AudioFormat. The file is not finalized (and may
+not be playable) until Close is called. */
+func CreateFile(filename string, codec CodecID, format AudioFormat) (*Muxer, error) {
+	var avctx *C.AVFormatContext
+	cfile := C.CString(filename)
+	defer C.free(unsafe.Pointer(cfile))
+
+	r := C.avformat_alloc_output_context2(&avctx, nil, nil, cfile)
+	if r < 0 {
+		return nil, avError(r)
+	}
+
+	mux, err := newMuxer(avctx, codec, format)
+	if err != nil {
+		return nil, err
+	}
+	if mux.ctx.oformat.flags&C.AVFMT_NOFILE == 0 {
+		r = C.avio_open(&mux.ctx.pb, cfile, C.AVIO_FLAG_WRITE)
+		if r < 0 {
+			mux.abort()
+			return nil, avError(r)
+		}
+	}
+	if err := mux.writeHeader(); err != nil {
+		mux.abort()
+		return nil, err
+	}
+	return mux, nil
+}
+
+/* Allocates the AVStream/AVCodecContext and opens the encoder for codec and
+format, without touching avctx.pb. Shared by CreateFile and CreateWriter,
+which differ only in how the underlying AVIOContext is obtained. On error,
+avctx (and anything already allocated onto the partial Muxer) is freed. */
+func newMuxer(avctx *C.AVFormatContext, codec CodecID, format AudioFormat) (*Muxer, error) {
+	mux := &Muxer{fmt: format, ctx: avctx}
+
+	encoder := C.avcodec_find_encoder(C.enum_AVCodecID(codec))
+	if encoder == nil {
+		mux.abort()
+		return nil, errors.New("no encoder available")
+	}
+	mux.stream = C.avformat_new_stream(mux.ctx, encoder)
+	if mux.stream == nil {
+		mux.abort()
+		return nil, errors.New("couldn't allocate output stream")
+	}
+
+	mux.codec = mux.stream.codec
+	mux.codec.sample_rate = C.int(format.Rate)
+	mux.codec.sample_fmt = int32(format.Storage)
+	mux.codec.channel_layout = C.uint64_t(format.Layout)
+	mux.codec.channels = C.int(format.NumChannels())
+	if mux.ctx.oformat.flags&C.AVFMT_GLOBALHEADER != 0 {
+		mux.codec.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
+	}
+
+	dict := (*C.AVDictionary)(nil)
+	r := C.avcodec_open2(mux.codec, encoder, &dict)
+	if r < 0 {
+		mux.abort()
+		return nil, avError(r)
+	}
+
+	mux.frame = C.av_frame_alloc()
+	if mux.frame == nil {
+		mux.abort()
+		return nil, errors.New("couldn't allocate frame")
+	}
+	mux.frame.format = C.int(mux.codec.sample_fmt)
+	mux.frame.channel_layout = mux.codec.channel_layout
+	mux.frame.sample_rate = mux.codec.sample_rate
+
+	return mux, nil
+}
+
+/* Tears down a Muxer that failed to finish initializing: frees whatever of
+frame/codec/pb/ctx has been allocated so far, without writing a trailer. */
+func (mux *Muxer) abort() {
+	if mux.frame != nil {
+		C.av_frame_free(&mux.frame)
+	}
+	if mux.codec != nil {
+		C.avcodec_close(mux.codec)
+	}
+	if mux.ctx.pb != nil {
+		/* AVFMT_FLAG_CUSTOM_IO is set the moment a CreateWriter-style pb is
+		attached to mux.ctx, before mux.customIO is - so it, not mux.customIO,
+		is what tells a pb avio_alloc_context built (and which avio_closep
+		doesn't know how to tear down) apart from one avio_open opened. */
+		if mux.ctx.flags&C.AVFMT_FLAG_CUSTOM_IO != 0 {
+			C.av_free(unsafe.Pointer(mux.ctx.pb.buffer))
+			C.avio_context_free(&mux.ctx.pb)
+		} else if mux.ctx.oformat != nil && mux.ctx.oformat.flags&C.AVFMT_NOFILE == 0 {
+			C.avio_closep(&mux.ctx.pb)
+		}
+	}
+	if mux.customIO != nil {
+		releaseHandle(mux.customIO)
+	}
+	C.avformat_free_context(mux.ctx)
+}
+
+func (mux *Muxer) writeHeader() error {
+	r := C.avformat_write_header(mux.ctx, nil)
+	if r < 0 {
+		return avError(r)
+	}
+	return nil
+}
+
+/* Pulls raw samples from src and encodes them. src is wrapped in a Chunker so
+the encoder sees frame_size samples per call, regardless of the chunk size
+src happens to produce, except for a final short frame at the end of src
+(and unless frame_size is 0, eg. for PCM, in which case samples are passed
+straight through). */
+func (mux *Muxer) Write(src SampleStream) error {
+	chunked, err := NewChunker(src, int(mux.codec.frame_size))
+	if err != nil {
+		return err
+	}
+	if chunker, ok := chunked.(*Chunker); ok {
+		defer chunker.freeBuffers()
+	}
+	for {
+		data, nf, _, err := chunked.read_raw()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if nf == 0 {
+			continue
+		}
+		mux.frame.extended_data = data
+		planes := (*[8]*C.uint8_t)(unsafe.Pointer(data))
+		for i := 0; i < mux.fmt.NumPlanes() && i < 8; i++ {
+			mux.frame.data[i] = planes[i]
+		}
+		mux.frame.nb_samples = nf
+		mux.frame.pts = mux.pts
+		mux.pts += C.int64_t(nf)
+		if _, err := mux.encode(mux.frame); err != nil {
+			return err
+		}
+	}
+}
+
+/* Encodes frame (nil to flush) and writes the resulting packet, if any. The
+returned bool reports whether a packet was actually produced, so callers
+flushing the encoder know when to stop: encoders with delay (AAC, MP3,
+Vorbis, ...) buffer several frames and only start emitting packets once
+that delay is drained, which can take more than one flush call. */
+func (mux *Muxer) encode(frame *C.AVFrame) (bool, error) {
+	var pkt C.AVPacket
+	C.av_init_packet(&pkt)
+	pkt.data = nil
+	pkt.size = 0
+
+	gotPacket := C.int(0)
+	r := C.avcodec_encode_audio2(mux.codec, &pkt, frame, &gotPacket)
+	if r < 0 {
+		return false, avError(r)
+	}
+	if gotPacket == 0 {
+		return false, nil
+	}
+	defer C.av_packet_unref(&pkt)
+
+	C.av_packet_rescale_ts(&pkt, mux.codec.time_base, mux.stream.time_base)
+	pkt.stream_index = mux.stream.index
+	r = C.av_interleaved_write_frame(mux.ctx, &pkt)
+	if r < 0 {
+		return false, avError(r)
+	}
+	return true, nil
+}
+
+/* Flushes any remaining samples, writes the trailer and releases all
+resources associated with the Muxer. */
+func (mux *Muxer) Close() error {
+	for {
+		gotPacket, err := mux.encode(nil)
+		if err != nil {
+			return err
+		}
+		if !gotPacket {
+			break
+		}
+	}
+	r := C.av_write_trailer(mux.ctx)
+	mux.abort()
+	if r < 0 {
+		return avError(r)
+	}
+	return nil
+}
@@ -6,6 +6,150 @@ import (
 	"unsafe"
 )
 
+/* fileSource bundles a decode chain (AudioStream, optionally wrapped in a
+Resampler) together with the FormatContext it was opened from, so that
+closing the convenience stream returned by eg. AsPackedS16s tears down the
+whole chain in one call. */
+type fileSource struct {
+	SampleStream
+	format *FormatContext
+}
+
+func (fs *fileSource) Close() {
+	fs.SampleStream.Close()
+	fs.format.Close()
+}
+
+/* Opens filename, decodes its "best" audio stream and converts it to packed
+signed 16-bit samples at the given rate/layout, inserting a Resampler only if
+the decoder could not be made to honour the request directly. The returned
+stream's Close() tears down the whole chain (decoder and underlying file). */
+func AsPackedS16s(filename string, rate int, layout ChannelLayout) (*PackedS16Stream, error) {
+	source, err := openAs(filename, AudioFormat{rate, PackedS16s, layout})
+	if err != nil {
+		return nil, err
+	}
+	stream, err := NewPackedS16Stream(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+/* Like AsPackedS16s, but for unsigned 8-bit packed samples. */
+func AsPackedU8s(filename string, rate int, layout ChannelLayout) (*PackedU8Stream, error) {
+	source, err := openAs(filename, AudioFormat{rate, PackedU8s, layout})
+	if err != nil {
+		return nil, err
+	}
+	stream, err := NewPackedU8Stream(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+/* Like AsPackedS16s, but for signed 32-bit packed samples. */
+func AsPackedS32s(filename string, rate int, layout ChannelLayout) (*PackedS32Stream, error) {
+	source, err := openAs(filename, AudioFormat{rate, PackedS32s, layout})
+	if err != nil {
+		return nil, err
+	}
+	stream, err := NewPackedS32Stream(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+/* Like AsPackedS16s, but for packed float samples. */
+func AsPackedFloats(filename string, rate int, layout ChannelLayout) (*PackedFloatStream, error) {
+	source, err := openAs(filename, AudioFormat{rate, PackedFloats, layout})
+	if err != nil {
+		return nil, err
+	}
+	stream, err := NewPackedFloatStream(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+/* Like AsPackedS16s, but for packed double samples. */
+func AsPackedDoubles(filename string, rate int, layout ChannelLayout) (*PackedDoubleStream, error) {
+	source, err := openAs(filename, AudioFormat{rate, PackedDoubles, layout})
+	if err != nil {
+		return nil, err
+	}
+	stream, err := NewPackedDoubleStream(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+/* Opens filename and returns a SampleStream in the requested format, hinting
+the decoder via request_channel_layout/request_sample_fmt and only falling
+back to a Resampler if the decoder couldn't honour the hint. */
+func openAs(filename string, want AudioFormat) (SampleStream, error) {
+	format, err := OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	audio, err := format.openAudioStream(want.Layout, want.Storage)
+	if err != nil {
+		format.Close()
+		return nil, err
+	}
+	var source SampleStream = audio
+	if !audio.Format().Equal(want) {
+		source, err = Resample(audio, want)
+		if err != nil {
+			audio.Close()
+			format.Close()
+			return nil, err
+		}
+	}
+	return &fileSource{source, format}, nil
+}
+
+type PackedU8Stream struct {
+	source SampleStream
+}
+
+/* Applies a PackedU8Stream to a SampleStream. */
+func NewPackedU8Stream(source SampleStream) (*PackedU8Stream, error) {
+	if source.Format().Storage != PackedU8s {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PackedU8Stream{source}, nil
+}
+
+func (stream PackedU8Stream) Close() {
+	stream.source.Close()
+}
+
+/* Reads unsigned 8-bit packed audio samples from the source stream and returns them
+contained within a slice. Note that no copy of the samples is made, so the slice
+will not remain valid once Read is called again. */
+func (stream PackedU8Stream) Read() ([]uint8, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	ns := int(fmt.NumChannels()) * int(nf)
+	if err != nil {
+		return []uint8{}, err
+	}
+	if data == nil {
+		return []uint8{}, nil
+	}
+	s := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(*data)), Len: ns, Cap: ns}
+	return *(*[]uint8)(unsafe.Pointer(&s)), nil
+}
+
 type PackedS16Stream struct {
 	source SampleStream
 }
@@ -18,12 +162,16 @@ func NewPackedS16Stream(source SampleStream) (*PackedS16Stream, error) {
 	return &PackedS16Stream{source}, nil
 }
 
+func (stream PackedS16Stream) Close() {
+	stream.source.Close()
+}
+
 /* Reads signed 16-bit packed audio samples from the source stream and returns them
 contained within a slice. Note that no copy of the samples is made, so the slice
 will not remain valid once Read is called again. */
 func (stream PackedS16Stream) Read() ([]int16, error) {
-	data, nf, err := stream.source.read_raw()
-	ns := int(stream.source.Format().NumChannels()) * int(nf)
+	data, nf, fmt, err := stream.source.read_raw()
+	ns := int(fmt.NumChannels()) * int(nf)
 	if err != nil {
 		return []int16{}, err
 	}
@@ -34,13 +182,283 @@ func (stream PackedS16Stream) Read() ([]int16, error) {
 	return *(*[]int16)(unsafe.Pointer(&s)), nil
 }
 
-/* potential target API:
+type PackedS32Stream struct {
+	source SampleStream
+}
+
+/* Applies a PackedS32Stream to a SampleStream. */
+func NewPackedS32Stream(source SampleStream) (*PackedS32Stream, error) {
+	if source.Format().Storage != PackedS32s {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PackedS32Stream{source}, nil
+}
+
+func (stream PackedS32Stream) Close() {
+	stream.source.Close()
+}
+
+/* Reads signed 32-bit packed audio samples from the source stream and returns them
+contained within a slice. Note that no copy of the samples is made, so the slice
+will not remain valid once Read is called again. */
+func (stream PackedS32Stream) Read() ([]int32, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	ns := int(fmt.NumChannels()) * int(nf)
+	if err != nil {
+		return []int32{}, err
+	}
+	if data == nil {
+		return []int32{}, nil
+	}
+	s := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(*data)), Len: ns, Cap: ns}
+	return *(*[]int32)(unsafe.Pointer(&s)), nil
+}
+
+type PackedFloatStream struct {
+	source SampleStream
+}
+
+/* Applies a PackedFloatStream to a SampleStream. */
+func NewPackedFloatStream(source SampleStream) (*PackedFloatStream, error) {
+	if source.Format().Storage != PackedFloats {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PackedFloatStream{source}, nil
+}
+
+func (stream PackedFloatStream) Close() {
+	stream.source.Close()
+}
+
+/* Reads packed float audio samples from the source stream and returns them
+contained within a slice. Note that no copy of the samples is made, so the slice
+will not remain valid once Read is called again. */
+func (stream PackedFloatStream) Read() ([]float32, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	ns := int(fmt.NumChannels()) * int(nf)
+	if err != nil {
+		return []float32{}, err
+	}
+	if data == nil {
+		return []float32{}, nil
+	}
+	s := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(*data)), Len: ns, Cap: ns}
+	return *(*[]float32)(unsafe.Pointer(&s)), nil
+}
+
+type PackedDoubleStream struct {
+	source SampleStream
+}
+
+/* Applies a PackedDoubleStream to a SampleStream. */
+func NewPackedDoubleStream(source SampleStream) (*PackedDoubleStream, error) {
+	if source.Format().Storage != PackedDoubles {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PackedDoubleStream{source}, nil
+}
+
+func (stream PackedDoubleStream) Close() {
+	stream.source.Close()
+}
+
+/* Reads packed double audio samples from the source stream and returns them
+contained within a slice. Note that no copy of the samples is made, so the slice
+will not remain valid once Read is called again. */
+func (stream PackedDoubleStream) Read() ([]float64, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	ns := int(fmt.NumChannels()) * int(nf)
+	if err != nil {
+		return []float64{}, err
+	}
+	if data == nil {
+		return []float64{}, nil
+	}
+	s := reflect.SliceHeader{Data: uintptr(unsafe.Pointer(*data)), Len: ns, Cap: ns}
+	return *(*[]float64)(unsafe.Pointer(&s)), nil
+}
+
+type PlanarU8Stream struct {
+	source SampleStream
+}
+
+/* Applies a PlanarU8Stream to a SampleStream. */
+func NewPlanarU8Stream(source SampleStream) (*PlanarU8Stream, error) {
+	if source.Format().Storage != PlanarU8s {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PlanarU8Stream{source}, nil
+}
+
+func (stream PlanarU8Stream) Close() {
+	stream.source.Close()
+}
+
+/* Reads unsigned 8-bit planar audio samples from the source stream, one slice per
+channel. Note that no copy of the samples is made, so the slices will not remain
+valid once Read is called again. */
+func (stream PlanarU8Stream) Read() ([][]uint8, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	out := make([][]uint8, fmt.NumPlanes())
+	base := uintptr(unsafe.Pointer(data))
+	for i := range out {
+		ptr := *(*uintptr)(unsafe.Pointer(base + uintptr(i*sizeOfPtr)))
+		s := reflect.SliceHeader{Data: ptr, Len: int(nf), Cap: int(nf)}
+		out[i] = *(*[]uint8)(unsafe.Pointer(&s))
+	}
+	return out, nil
+}
+
+type PlanarS16Stream struct {
+	source SampleStream
+}
 
-AsPackedS16s(filename string, desiredSampleRate int, desiredLayout ChannelLayout) PackedS16Stream
+/* Applies a PlanarS16Stream to a SampleStream. */
+func NewPlanarS16Stream(source SampleStream) (*PlanarS16Stream, error) {
+	if source.Format().Storage != PlanarS16s {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PlanarS16Stream{source}, nil
+}
 
-(allows use of request_channel_layout/request_sample_fmt fields on CodecContext)
+func (stream PlanarS16Stream) Close() {
+	stream.source.Close()
+}
 
-and then:
+/* Reads signed 16-bit planar audio samples from the source stream, one slice per
+channel. Note that no copy of the samples is made, so the slices will not remain
+valid once Read is called again. */
+func (stream PlanarS16Stream) Read() ([][]int16, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	out := make([][]int16, fmt.NumPlanes())
+	base := uintptr(unsafe.Pointer(data))
+	for i := range out {
+		ptr := *(*uintptr)(unsafe.Pointer(base + uintptr(i*sizeOfPtr)))
+		s := reflect.SliceHeader{Data: ptr, Len: int(nf), Cap: int(nf)}
+		out[i] = *(*[]int16)(unsafe.Pointer(&s))
+	}
+	return out, nil
+}
 
-PackedS16Stream.Close() to cleanup all memory.
-*/
+type PlanarS32Stream struct {
+	source SampleStream
+}
+
+/* Applies a PlanarS32Stream to a SampleStream. */
+func NewPlanarS32Stream(source SampleStream) (*PlanarS32Stream, error) {
+	if source.Format().Storage != PlanarS32s {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PlanarS32Stream{source}, nil
+}
+
+func (stream PlanarS32Stream) Close() {
+	stream.source.Close()
+}
+
+/* Reads signed 32-bit planar audio samples from the source stream, one slice per
+channel. Note that no copy of the samples is made, so the slices will not remain
+valid once Read is called again. */
+func (stream PlanarS32Stream) Read() ([][]int32, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	out := make([][]int32, fmt.NumPlanes())
+	base := uintptr(unsafe.Pointer(data))
+	for i := range out {
+		ptr := *(*uintptr)(unsafe.Pointer(base + uintptr(i*sizeOfPtr)))
+		s := reflect.SliceHeader{Data: ptr, Len: int(nf), Cap: int(nf)}
+		out[i] = *(*[]int32)(unsafe.Pointer(&s))
+	}
+	return out, nil
+}
+
+type PlanarFloatStream struct {
+	source SampleStream
+}
+
+/* Applies a PlanarFloatStream to a SampleStream. */
+func NewPlanarFloatStream(source SampleStream) (*PlanarFloatStream, error) {
+	if source.Format().Storage != PlanarFloats {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PlanarFloatStream{source}, nil
+}
+
+func (stream PlanarFloatStream) Close() {
+	stream.source.Close()
+}
+
+/* Reads planar float audio samples from the source stream, one slice per channel.
+Note that no copy of the samples is made, so the slices will not remain valid once
+Read is called again. */
+func (stream PlanarFloatStream) Read() ([][]float32, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	out := make([][]float32, fmt.NumPlanes())
+	base := uintptr(unsafe.Pointer(data))
+	for i := range out {
+		ptr := *(*uintptr)(unsafe.Pointer(base + uintptr(i*sizeOfPtr)))
+		s := reflect.SliceHeader{Data: ptr, Len: int(nf), Cap: int(nf)}
+		out[i] = *(*[]float32)(unsafe.Pointer(&s))
+	}
+	return out, nil
+}
+
+type PlanarDoubleStream struct {
+	source SampleStream
+}
+
+/* Applies a PlanarDoubleStream to a SampleStream. */
+func NewPlanarDoubleStream(source SampleStream) (*PlanarDoubleStream, error) {
+	if source.Format().Storage != PlanarDoubles {
+		return nil, errors.New("sample format mismatch")
+	}
+	return &PlanarDoubleStream{source}, nil
+}
+
+func (stream PlanarDoubleStream) Close() {
+	stream.source.Close()
+}
+
+/* Reads planar double audio samples from the source stream, one slice per channel.
+Note that no copy of the samples is made, so the slices will not remain valid once
+Read is called again. */
+func (stream PlanarDoubleStream) Read() ([][]float64, error) {
+	data, nf, fmt, err := stream.source.read_raw()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	out := make([][]float64, fmt.NumPlanes())
+	base := uintptr(unsafe.Pointer(data))
+	for i := range out {
+		ptr := *(*uintptr)(unsafe.Pointer(base + uintptr(i*sizeOfPtr)))
+		s := reflect.SliceHeader{Data: ptr, Len: int(nf), Cap: int(nf)}
+		out[i] = *(*[]float64)(unsafe.Pointer(&s))
+	}
+	return out, nil
+}
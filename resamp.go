@@ -26,6 +26,7 @@ type ChannelLayout C.int64_t // TODO proper enum?
 itself implements the SampleStream interface. */
 type Resampler struct {
 	fmt       AudioFormat
+	from      AudioFormat // format of the source stream, as of the last swr_alloc_set_opts
 	ctx       *C.SwrContext
 	source    SampleStream
 	sourceEOF bool
@@ -34,6 +35,14 @@ type Resampler struct {
 	nplanes   int
 	nf        C.int // samples allocated (per plane)
 	buf       *C.uint8_t
+
+	// set while draining the old SwrContext after a mid-stream format change;
+	// pendingIn/pendingNf/pendingFrom are the already-read samples that
+	// triggered the change, held back until the drain finishes.
+	draining    bool
+	pendingIn   **C.uint8_t
+	pendingNf   C.int
+	pendingFrom AudioFormat
 }
 
 var sizeOfPtr int
@@ -80,24 +89,50 @@ func Resample(source SampleStream, to AudioFormat) (SampleStream, error) {
 	if from.Equal(to) {
 		return source, nil /* no-op */
 	}
+	if err := resamp.reinit(from); err != nil {
+		return nil, err
+	}
+	return &resamp, nil
+}
+
+/* (Re)allocates the underlying SwrContext for converting from the given input
+format to resamp.fmt, freeing any previous context first. Called both when
+the Resampler is first created and whenever the source starts yielding frames
+in a different format mid-stream. */
+func (resamp *Resampler) reinit(from AudioFormat) error {
+	to := resamp.fmt
+	if resamp.ctx != nil {
+		C.swr_free(&resamp.ctx)
+	}
 	resamp.ctx = C.swr_alloc_set_opts(nil,
 		C.int64_t(to.Layout), int32(to.Storage), C.int(to.Rate),
 		C.int64_t(from.Layout), int32(from.Storage), C.int(from.Rate),
 		0, nil)
 	if resamp.ctx == nil {
-		return nil, errors.New("couldn't allocate resampling context")
+		return errors.New("couldn't allocate resampling context")
 	}
-	resamp.sratio = float64(to.Rate) / float64(from.Rate)
 	r := C.swr_init(resamp.ctx)
 	if r < 0 {
-		return nil, avError(r, "swr_init")
+		return avError(r)
 	}
-	resamp.nplanes = from.NumPlanes()
-	resamp.data = (**C.uint8_t)(C.malloc(C.size_t(uintptr(from.NumPlanes() * sizeOfPtr))))
-	if resamp.data == nil {
-		return nil, errors.New("couldn't allocate resampler channel pointers")
+	resamp.from = from
+	resamp.sratio = float64(to.Rate) / float64(from.Rate)
+	if resamp.nplanes != from.NumPlanes() {
+		if resamp.data != nil {
+			C.free(unsafe.Pointer(resamp.data))
+		}
+		resamp.nplanes = from.NumPlanes()
+		resamp.data = (**C.uint8_t)(C.malloc(C.size_t(uintptr(resamp.nplanes * sizeOfPtr))))
+		if resamp.data == nil {
+			return errors.New("couldn't allocate resampler channel pointers")
+		}
+		/* checkBuf only repopulates the per-plane pointer layout when it grows
+		resamp.buf (resamp.nf < nf); forget the current allocation so the next
+		checkBuf call re-derives pointers for the new plane count even if nf
+		itself doesn't grow. */
+		resamp.nf = 0
 	}
-	return &resamp, nil
+	return nil
 }
 
 /* Frees memory associated with a Resampler, and closes the source stream. */
@@ -144,29 +179,72 @@ func (resamp *Resampler) checkBuf(nf C.int) error {
 	return nil
 }
 
-func (resamp *Resampler) read_raw() (**C.uint8_t, C.int, error) {
+func (resamp *Resampler) read_raw() (**C.uint8_t, C.int, AudioFormat, error) {
+	if resamp.draining {
+		n, err := resamp.drainStep()
+		if err != nil {
+			return nil, 0, resamp.fmt, err
+		}
+		if n > 0 {
+			return resamp.data, n, resamp.fmt, nil
+		}
+		resamp.draining = false
+		if err := resamp.reinit(resamp.pendingFrom); err != nil {
+			return nil, 0, resamp.fmt, err
+		}
+		return resamp.convert(resamp.pendingIn, resamp.pendingNf)
+	}
+
 	in := (**C.uint8_t)(nil)
 	nf := C.int(0)
 	if !resamp.sourceEOF {
 		var err error
-		in, nf, err = resamp.source.read_raw()
+		var from AudioFormat
+		in, nf, from, err = resamp.source.read_raw()
 		if err == io.EOF {
 			resamp.sourceEOF = true
 		} else if err != nil {
-			return nil, 0, err
+			return nil, 0, resamp.fmt, err
 		} else if nf == 0 {
-			return nil, 0, nil
-		}
-		err = resamp.checkBuf(C.int(math.Ceil(float64(nf) * resamp.sratio)))
-		if err != nil {
-			return nil, 0, err
+			return nil, 0, resamp.fmt, nil
+		} else if !from.Equal(resamp.from) {
+			/* the source switched sample rate/layout/format mid-stream (eg. an HLS
+			segment boundary). The old context may still have samples buffered
+			that were converted under the previous params - flush those out (over
+			as many calls as it takes) before reiniting for the new format, then
+			hand off the already-read in/nf that triggered the switch. */
+			resamp.draining = true
+			resamp.pendingIn, resamp.pendingNf, resamp.pendingFrom = in, nf, from
+			return resamp.read_raw()
 		}
 	}
+	return resamp.convert(in, nf)
+}
+
+/* Runs in to resamp.nf samples through swr_convert and returns them. */
+func (resamp *Resampler) convert(in **C.uint8_t, nf C.int) (**C.uint8_t, C.int, AudioFormat, error) {
+	if err := resamp.checkBuf(C.int(math.Ceil(float64(nf) * resamp.sratio))); err != nil {
+		return nil, 0, resamp.fmt, err
+	}
 	nfout := C.swr_convert(resamp.ctx, resamp.data, resamp.nf, in, nf)
 	if nfout == 0 {
-		return nil, 0, io.EOF
+		return nil, 0, resamp.fmt, io.EOF
+	}
+	return resamp.data, nfout, resamp.fmt, nil
+}
+
+/* Pulls one batch of samples still buffered inside the (about to be replaced)
+SwrContext, for the caller to consume before the format switch takes effect.
+Returns 0 once the context has nothing left to flush. */
+func (resamp *Resampler) drainStep() (C.int, error) {
+	if err := resamp.checkBuf(C.int(math.Ceil(128 * resamp.sratio))); err != nil {
+		return 0, err
+	}
+	n := C.swr_convert(resamp.ctx, resamp.data, resamp.nf, nil, 0)
+	if n < 0 {
+		return 0, avError(n)
 	}
-	return resamp.data, nfout, nil
+	return n, nil
 }
 
 func dumpPlanarStereo(data **C.uint8_t, nf C.int) {
@@ -0,0 +1,98 @@
+package ffau
+
+import (
+	"io"
+	"testing"
+	"unsafe"
+)
+
+/*
+#include <stdlib.h>
+#include <libavutil/samplefmt.h>
+*/
+import "C"
+
+/* concatStream glues a fixed sequence of raw buffers together, switching
+AudioFormat partway through - standing in for eg. two decoders of different
+sample rates played back to back - so Resampler's mid-stream reinit/drain
+path can be exercised without needing real media files. */
+type concatStream struct {
+	segments []rawSegment
+	i        int
+}
+
+type rawSegment struct {
+	fmt  AudioFormat
+	data **C.uint8_t
+	nf   C.int
+}
+
+func (c *concatStream) Format() AudioFormat {
+	return c.segments[0].fmt
+}
+
+func (c *concatStream) Close() {
+	for _, seg := range c.segments {
+		C.free(unsafe.Pointer(*seg.data))
+		C.free(unsafe.Pointer(seg.data))
+	}
+}
+
+func (c *concatStream) read_raw() (**C.uint8_t, C.int, AudioFormat, error) {
+	if c.i >= len(c.segments) {
+		return nil, 0, c.segments[len(c.segments)-1].fmt, io.EOF
+	}
+	seg := c.segments[c.i]
+	c.i++
+	return seg.data, seg.nf, seg.fmt, nil
+}
+
+/* makeSegment allocates nf zeroed samples of fmt (packed only, for simplicity)
+behind a single plane pointer, as a decoder's read_raw would return. */
+func makeSegment(fmt AudioFormat, nf int) rawSegment {
+	nbytes := nf * fmt.NumChannels() * int(C.av_get_bytes_per_sample(int32(fmt.Storage)))
+	buf := C.calloc(C.size_t(nbytes), 1)
+	data := (**C.uint8_t)(C.malloc(C.size_t(sizeOfPtr)))
+	*data = (*C.uint8_t)(buf)
+	return rawSegment{fmt: fmt, data: data, nf: C.int(nf)}
+}
+
+/* Regression test for a Resampler fed two segments at different sample rates
+back to back: reading it through to io.EOF across the switch (which drains the
+old SwrContext and reinits for the new rate) must not return an error, and
+must produce some output. */
+func TestResamplerMidStreamFormatChange(t *testing.T) {
+	low := AudioFormat{Rate: 22050, Storage: PackedS16s, Layout: DefaultLayout(2)}
+	high := AudioFormat{Rate: 44100, Storage: PackedS16s, Layout: DefaultLayout(2)}
+
+	src := &concatStream{segments: []rawSegment{
+		makeSegment(low, 1024),
+		makeSegment(high, 1024),
+	}}
+
+	out, err := Resample(src, high)
+	if err != nil {
+		t.Fatalf("Resample: %v", err)
+	}
+	defer out.Close()
+
+	resamp, ok := out.(*Resampler)
+	if !ok {
+		t.Fatalf("expected Resample to allocate a Resampler for differing formats")
+	}
+
+	total := 0
+	for {
+		_, nf, _, err := resamp.read_raw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read_raw: %v", err)
+		}
+		total += int(nf)
+	}
+	if total == 0 {
+		t.Fatal("expected some resampled output across the format change")
+	}
+}